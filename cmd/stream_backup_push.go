@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/tracelog"
+)
+
+const streamBackupPushShortDescription = "Packs files from a directory into a single streamed tar object instead of one object per file"
+
+var streamBackupPushCmd = &cobra.Command{
+	Use:   "stream-backup-push directory",
+	Short: streamBackupPushShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		directory := args[0]
+
+		files, err := listRegularFiles(directory)
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		folder, err := internal.ConfigureFolder()
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		packer, err := internal.ConfigureStreamArchivePacker()
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		backupName := "stream_backup_" + time.Now().Format("20060102T150405Z")
+		offsets, err := packer.PackAndUpload(folder, backupName, files)
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		tracelog.InfoLogger.Printf("stream-backup-push: uploaded '%s' with %d files packed\n", backupName, len(offsets))
+	},
+}
+
+func listRegularFiles(directory string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// pg_tblspc/* entries are symlinks to tablespace directories that
+			// live outside PGDATA; filepath.Walk lstats them and never
+			// descends into the target, so without this they'd silently
+			// vanish from the backup. Follow the link instead of skipping it.
+			targetFiles, err := listSymlinkTarget(path)
+			if err != nil {
+				return errors.Wrapf(err, "failed to follow symlink '%s'", path)
+			}
+			files = append(files, targetFiles...)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
+
+// listSymlinkTarget resolves the symlink at path and returns the regular
+// file(s) it points at: the target itself if it's a regular file, or every
+// regular file under it if it's a directory (as with a pg_tblspc tablespace
+// link).
+func listSymlinkTarget(path string) ([]string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.IsDir() {
+		return listRegularFiles(resolved)
+	}
+	if target.Mode().IsRegular() {
+		return []string{resolved}, nil
+	}
+	return nil, nil
+}
+
+func init() {
+	Command.AddCommand(streamBackupPushCmd)
+}
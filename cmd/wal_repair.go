@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/tracelog"
+)
+
+const walRepairShortDescription = "Truncates a corrupted WAL segment at its last valid record and re-uploads the repaired copy"
+
+var walRepairCmd = &cobra.Command{
+	Use:   "wal-repair wal_filename",
+	Short: walRepairShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		walFileName := args[0]
+
+		uploader, err := internal.ConfigureUploader()
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		repairedFileName, written, err := internal.RepairWALObject(
+			uploader.UploadingFolder, uploader.Compressor, internal.ConfigureCrypter(), walFileName)
+		if err != nil {
+			tracelog.ErrorLogger.FatalError(err)
+		}
+
+		tracelog.InfoLogger.Printf("wal-repair: uploaded '%s' (%d bytes of WAL record data), original '%s' left in place for audit\n",
+			repairedFileName, written, walFileName)
+	},
+}
+
+func init() {
+	Command.AddCommand(walRepairCmd)
+}
@@ -0,0 +1,43 @@
+package compression
+
+import "bytes"
+
+// ArchiveFormat bundles everything the uploader/downloader need to treat a
+// compression method as a self-describing archive format: its extension for
+// naming new objects, the magic bytes to recognize it on read, and the
+// Compressor/Decompressor pair that do the actual streaming.
+type ArchiveFormat struct {
+	Name          string
+	FileExtension string
+	MagicBytes    []byte
+	Compressor    Compressor
+	Decompressor  Decompressor
+}
+
+// ArchiveFormats holds every format registered via RegisterArchiveFormat, in
+// registration order.
+var ArchiveFormats []ArchiveFormat
+
+// RegisterArchiveFormat wires a format into the existing Compressors,
+// Decompressors and CompressingAlgorithms registries and makes it
+// discoverable by magic bytes through DetectArchiveFormat. Each format
+// package calls this from its own init().
+func RegisterArchiveFormat(format ArchiveFormat) {
+	ArchiveFormats = append(ArchiveFormats, format)
+	Compressors[format.Name] = format.Compressor
+	Decompressors[format.Name] = format.Decompressor
+	CompressingAlgorithms = append(CompressingAlgorithms, format.Name)
+}
+
+// DetectArchiveFormat returns the archive format whose magic bytes prefix
+// header, so a download can pick the right Decompressor even when
+// WALG_COMPRESSION_METHOD has changed since the object was uploaded and the
+// filename suffix no longer matches its actual contents.
+func DetectArchiveFormat(header []byte) (ArchiveFormat, bool) {
+	for _, format := range ArchiveFormats {
+		if len(format.MagicBytes) > 0 && bytes.HasPrefix(header, format.MagicBytes) {
+			return format, true
+		}
+	}
+	return ArchiveFormat{}, false
+}
@@ -0,0 +1,95 @@
+package pgzip
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/klauspost/pgzip"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+const (
+	AlgorithmName = "pgzip"
+	FileExtension = "gz"
+
+	// DefaultBlockSize is used when WALG_PGZIP_BLOCK_SIZE is not set.
+	DefaultBlockSize = 1 << 20 // 1 MiB, same default as klauspost/pgzip
+
+	// DefaultConcurrency of 1 keeps pgzip's output byte-for-byte comparable
+	// to stdlib gzip unless the user opts into parallelism explicitly.
+	DefaultConcurrency = 1
+)
+
+// MagicBytes is the standard gzip magic number: pgzip produces an ordinary
+// gzip stream, just written by several goroutines at once, so it shares the
+// format's magic with every other gzip-compatible compressor.
+var MagicBytes = []byte{0x1f, 0x8b}
+
+func init() {
+	compression.RegisterArchiveFormat(compression.ArchiveFormat{
+		Name:          AlgorithmName,
+		FileExtension: FileExtension,
+		MagicBytes:    MagicBytes,
+		Compressor:    Compressor{Concurrency: DefaultConcurrency, BlockSize: DefaultBlockSize},
+		Decompressor:  Decompressor{},
+	})
+}
+
+// Compressor produces a standard gzip stream using klauspost/pgzip, splitting
+// the input into independently compressed blocks so it can be written by
+// several goroutines at once. Output remains readable by any gzip decoder,
+// including the single-threaded Decompressor below.
+type Compressor struct {
+	Concurrency int
+	BlockSize   int
+}
+
+func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	gzWriter := pgzip.NewWriter(writer)
+
+	blockSize := compressor.BlockSize
+	// klauspost/pgzip rejects block sizes of 16 KiB or less.
+	if blockSize <= 16<<10 {
+		blockSize = DefaultBlockSize
+	}
+
+	concurrency := compressor.Concurrency
+	if concurrency == 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if concurrency < 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	if err := gzWriter.SetConcurrency(blockSize, concurrency); err != nil {
+		// SetConcurrency only fails on invalid arguments, which can't happen
+		// with the sanitized values above.
+		panic(errors.Wrap(err, "pgzip: failed to configure concurrency"))
+	}
+
+	return gzWriter
+}
+
+func (compressor Compressor) FileExtension() string {
+	return FileExtension
+}
+
+// Decompressor reads any valid gzip stream, including ones produced by
+// Compressor or by the single-threaded compressors used elsewhere.
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(dst io.Writer, src io.Reader) error {
+	gzReader, err := pgzip.NewReader(src)
+	if err != nil {
+		return errors.Wrap(err, "pgzip: failed to create reader")
+	}
+	defer gzReader.Close()
+
+	_, err = io.Copy(dst, gzReader)
+	return errors.Wrap(err, "pgzip: failed to decompress")
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
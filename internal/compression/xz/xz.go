@@ -0,0 +1,59 @@
+package xz
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+const (
+	AlgorithmName = "xz"
+	FileExtension = "xz"
+)
+
+// MagicBytes is the fixed 6-byte xz stream header magic, used to recognize
+// xz objects on read regardless of what WALG_COMPRESSION_METHOD is set to.
+var MagicBytes = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+func init() {
+	compression.RegisterArchiveFormat(compression.ArchiveFormat{
+		Name:          AlgorithmName,
+		FileExtension: FileExtension,
+		MagicBytes:    MagicBytes,
+		Compressor:    Compressor{},
+		Decompressor:  Decompressor{},
+	})
+}
+
+type Compressor struct{}
+
+func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	xzWriter, err := xz.NewWriter(writer)
+	if err != nil {
+		// Only fails on invalid options, none of which are used here.
+		panic(errors.Wrap(err, "xz: failed to create writer"))
+	}
+	return xzWriter
+}
+
+func (compressor Compressor) FileExtension() string {
+	return FileExtension
+}
+
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(dst io.Writer, src io.Reader) error {
+	xzReader, err := xz.NewReader(src)
+	if err != nil {
+		return errors.Wrap(err, "xz: failed to create reader")
+	}
+
+	_, err = io.Copy(dst, xzReader)
+	return errors.Wrap(err, "xz: failed to decompress")
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
@@ -0,0 +1,60 @@
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+const (
+	AlgorithmName = "zstd"
+	FileExtension = "zst"
+)
+
+// MagicBytes is the fixed 4-byte zstd frame magic number, used to recognize
+// zstd objects on read regardless of what WALG_COMPRESSION_METHOD is set to.
+var MagicBytes = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func init() {
+	compression.RegisterArchiveFormat(compression.ArchiveFormat{
+		Name:          AlgorithmName,
+		FileExtension: FileExtension,
+		MagicBytes:    MagicBytes,
+		Compressor:    Compressor{},
+		Decompressor:  Decompressor{},
+	})
+}
+
+type Compressor struct{}
+
+func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	zstdWriter, err := zstd.NewWriter(writer)
+	if err != nil {
+		// Only fails on invalid options, none of which are used here.
+		panic(errors.Wrap(err, "zstd: failed to create writer"))
+	}
+	return zstdWriter
+}
+
+func (compressor Compressor) FileExtension() string {
+	return FileExtension
+}
+
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(dst io.Writer, src io.Reader) error {
+	zstdReader, err := zstd.NewReader(src)
+	if err != nil {
+		return errors.Wrap(err, "zstd: failed to create reader")
+	}
+	defer zstdReader.Close()
+
+	_, err = io.Copy(dst, zstdReader)
+	return errors.Wrap(err, "zstd: failed to decompress")
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
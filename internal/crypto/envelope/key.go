@@ -0,0 +1,103 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize is the length in bytes of the AES-256 key this package expects,
+// however it is supplied.
+const KeySize = 32
+
+// scryptSalt is fixed rather than random because WAL-G has nowhere to persist
+// a per-key salt alongside WALG_SYMMETRIC_PASSPHRASE: the same passphrase must
+// always derive the same key so archived WAL written by one host can be
+// decrypted by another.
+var scryptSalt = []byte("wal-g/internal/crypto/envelope")
+
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// CrypterFromKey builds a Crypter from a raw key given directly as a string,
+// in raw, hex, or base64 form (see parseKey).
+func CrypterFromKey(rawKey string) *Crypter {
+	return &Crypter{rawKey: rawKey}
+}
+
+// CrypterFromKeyPath builds a Crypter that reads its key, in raw, hex, or
+// base64 form, from the file at keyPath.
+func CrypterFromKeyPath(keyPath string) *Crypter {
+	return &Crypter{keyPath: keyPath}
+}
+
+// CrypterFromPassphrase builds a Crypter that derives its key from passphrase
+// via scrypt.
+func CrypterFromPassphrase(passphrase string) *Crypter {
+	return &Crypter{passphrase: passphrase}
+}
+
+// CrypterFromRawKey builds a Crypter directly from already-resolved key
+// bytes, e.g. a per-object data key unwrapped via a KMS provider, bypassing
+// the hex/base64/passphrase resolution the other constructors go through.
+func CrypterFromRawKey(key []byte) (*Crypter, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	crypter := &Crypter{key: key}
+	crypter.keyOnce.Do(func() {})
+	return crypter, nil
+}
+
+func (crypter *Crypter) resolveKey() ([]byte, error) {
+	crypter.keyOnce.Do(func() {
+		crypter.key, crypter.keyErr = crypter.loadKey()
+	})
+	return crypter.key, crypter.keyErr
+}
+
+func (crypter *Crypter) loadKey() ([]byte, error) {
+	if crypter.passphrase != "" {
+		return deriveKeyFromPassphrase(crypter.passphrase)
+	}
+
+	rawKey := crypter.rawKey
+	if crypter.keyPath != "" {
+		keyFileBytes, err := ioutil.ReadFile(crypter.keyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read key file '%s'", crypter.keyPath)
+		}
+		rawKey = strings.TrimSpace(string(keyFileBytes))
+	}
+
+	return parseKey(rawKey)
+}
+
+// parseKey accepts a key given as KeySize raw bytes, as hex, or as base64.
+func parseKey(rawKey string) ([]byte, error) {
+	if decoded, err := hex.DecodeString(rawKey); err == nil && len(decoded) == KeySize {
+		return decoded, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(rawKey); err == nil && len(decoded) == KeySize {
+		return decoded, nil
+	}
+	if len(rawKey) == KeySize {
+		return []byte(rawKey), nil
+	}
+	return nil, errors.Errorf("key must be %d raw bytes, hex-encoded, or base64-encoded", KeySize)
+}
+
+func deriveKeyFromPassphrase(passphrase string) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), scryptSalt, scryptN, scryptR, scryptP, KeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive key from WALG_SYMMETRIC_PASSPHRASE")
+	}
+	return key, nil
+}
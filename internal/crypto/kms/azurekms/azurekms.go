@@ -0,0 +1,77 @@
+// Package azurekms implements kms.Provider using Azure Key Vault, selected
+// by setting WALG_KMS_PROVIDER=azure. The vault is located via
+// WALG_KMS_AZURE_VAULT_URL and credentials are resolved via
+// DefaultAzureCredential.
+package azurekms
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+	"github.com/pkg/errors"
+	walgkms "github.com/wal-g/wal-g/internal/crypto/kms"
+)
+
+const Name = "azure"
+
+const encryptionAlgorithm = azkeys.EncryptionAlgorithmRSAOAEP256
+
+func init() {
+	walgkms.RegisterProvider(Name, New)
+}
+
+type Provider struct {
+	client *azkeys.Client
+	// keyID is the key name within the vault set by WALG_KMS_AZURE_VAULT_URL.
+	keyID string
+}
+
+func New(keyID string) (walgkms.Provider, error) {
+	vaultURL := walgkms.SettingsLookup("WALG_KMS_AZURE_VAULT_URL")
+	if vaultURL == "" {
+		return nil, errors.New("azurekms: WALG_KMS_AZURE_VAULT_URL must be set")
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "azurekms: failed to resolve Azure credentials")
+	}
+
+	client, err := azkeys.NewClient(vaultURL, credential, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "azurekms: failed to create Key Vault client")
+	}
+
+	return &Provider{client: client, keyID: keyID}, nil
+}
+
+func (provider *Provider) Name() string {
+	return Name
+}
+
+func (provider *Provider) KeyID() string {
+	return provider.keyID
+}
+
+func (provider *Provider) Encrypt(plaintextDEK []byte) ([]byte, error) {
+	response, err := provider.client.Encrypt(context.Background(), provider.keyID, "", azkeys.KeyOperationParameters{
+		Algorithm: &encryptionAlgorithm,
+		Value:     plaintextDEK,
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "azurekms: Encrypt call failed")
+	}
+	return response.Result, nil
+}
+
+func (provider *Provider) Decrypt(wrappedDEK []byte) ([]byte, error) {
+	response, err := provider.client.Decrypt(context.Background(), provider.keyID, "", azkeys.KeyOperationParameters{
+		Algorithm: &encryptionAlgorithm,
+		Value:     wrappedDEK,
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "azurekms: Decrypt call failed")
+	}
+	return response.Result, nil
+}
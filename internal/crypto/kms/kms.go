@@ -0,0 +1,68 @@
+// Package kms abstracts over cloud key-management services so envelope
+// encryption can wrap its per-object data key with AWS KMS, GCP KMS, or
+// Azure Key Vault without the backup host ever holding a long-lived private
+// key.
+package kms
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Provider wraps a cloud KMS's Encrypt/Decrypt of a small data-encryption
+// key (DEK). The wrapped DEK it returns is opaque and provider-specific; it
+// is stored verbatim alongside Name and KeyID in the object header. A later
+// Decrypt goes through whichever Provider is configured at that time; the
+// stored KeyID is not used to pick the key.
+type Provider interface {
+	Name() string
+	KeyID() string
+	Encrypt(plaintextDEK []byte) (wrappedDEK []byte, err error)
+	Decrypt(wrappedDEK []byte) (plaintextDEK []byte, err error)
+}
+
+// Factory constructs a Provider bound to keyID, reading any provider-specific
+// auth settings (region, vault URL, credentials) from the environment itself.
+type Factory func(keyID string) (Provider, error)
+
+// Providers holds every backend registered via RegisterProvider, keyed by
+// the value users set in WALG_KMS_PROVIDER.
+var Providers = map[string]Factory{}
+
+// RegisterProvider makes a KMS backend selectable via WALG_KMS_PROVIDER. Each
+// provider subpackage calls this from its own init().
+func RegisterProvider(name string, factory Factory) {
+	Providers[name] = factory
+}
+
+// SettingsLookup resolves a provider-specific setting (region, vault URL,
+// ...) by name. Provider packages call this instead of os.Getenv directly,
+// so those settings go through the same WALG_* source (env var or config
+// file) as every other setting instead of being locked to raw environment
+// variables.
+//
+// internal.init() rebinds this to internal.GetSettingValue. It can't be
+// wired the other way around: internal already imports these provider
+// packages for their init() registration side effect, so having them import
+// internal back would be a cycle. Defaults to os.Getenv so a provider still
+// works if nothing rebinds it (e.g. a provider package's own unit tests).
+var SettingsLookup = os.Getenv
+
+// ConfigureProvider builds the Provider named by providerName, bound to
+// keyID.
+func ConfigureProvider(providerName, keyID string) (Provider, error) {
+	factory, ok := Providers[providerName]
+	if !ok {
+		return nil, errors.Errorf("unknown KMS provider '%s', supported providers are: %v", providerName, providerNames())
+	}
+	return factory(keyID)
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	return names
+}
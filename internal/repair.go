@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/storages/storage"
+	"github.com/wal-g/wal-g/internal/walrepair"
+)
+
+// RepairWALObject downloads walFileName from folder, decrypts it (only when
+// crypter is non-nil) and decompresses it (with the format picked by
+// ConfigureDecompressor), truncates it at its last valid WAL record via
+// walrepair.Repair, then re-compresses/re-encrypts the repaired bytes and
+// uploads them under a ".repaired" suffix, leaving the original in place
+// for audit. It's shared by the manual `wal-g wal-repair` command and
+// AutoRepairWAL's wal-fetch integration point.
+func RepairWALObject(folder storage.Folder, compressor compression.Compressor, crypter crypto.Crypter, walFileName string) (repairedFileName string, written int64, err error) {
+	reader, err := folder.ReadObject(walFileName)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "wal-repair: failed to read '%s'", walFileName)
+	}
+	stored, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to download object")
+	}
+	if err := reader.Close(); err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to close downloaded object")
+	}
+
+	compressed := stored
+	if crypter != nil {
+		decryptedReader, err := crypter.Decrypt(bytes.NewReader(stored))
+		if err != nil {
+			return "", 0, errors.Wrap(err, "wal-repair: failed to decrypt object")
+		}
+		compressed, err = ioutil.ReadAll(decryptedReader)
+		if err != nil {
+			return "", 0, errors.Wrap(err, "wal-repair: failed to read decrypted object")
+		}
+	}
+
+	decompressor, err := ConfigureDecompressor(compressed)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to configure decompressor")
+	}
+	var plaintext bytes.Buffer
+	if err := decompressor.Decompress(&plaintext, bytes.NewReader(compressed)); err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to decompress object")
+	}
+
+	var repairedPlaintext bytes.Buffer
+	written, err = walrepair.Repair(walFileName, bytes.NewReader(plaintext.Bytes()), &repairedPlaintext)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var repairedCompressed bytes.Buffer
+	compressWriter := compressor.NewWriter(&repairedCompressed)
+	if _, err := compressWriter.Write(repairedPlaintext.Bytes()); err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to compress repaired object")
+	}
+	if err := compressWriter.Close(); err != nil {
+		return "", 0, errors.Wrap(err, "wal-repair: failed to finish compressing repaired object")
+	}
+
+	var repaired io.Reader = &repairedCompressed
+	if crypter != nil {
+		var encrypted bytes.Buffer
+		encryptWriter, err := crypter.Encrypt(&encrypted)
+		if err != nil {
+			return "", 0, errors.Wrap(err, "wal-repair: failed to encrypt repaired object")
+		}
+		if _, err := encryptWriter.Write(repairedCompressed.Bytes()); err != nil {
+			return "", 0, errors.Wrap(err, "wal-repair: failed to write encrypted repaired object")
+		}
+		if err := encryptWriter.Close(); err != nil {
+			return "", 0, errors.Wrap(err, "wal-repair: failed to finish encrypting repaired object")
+		}
+		repaired = &encrypted
+	}
+
+	repairedFileName = walFileName + ".repaired"
+	if err := folder.PutObject(repairedFileName, repaired); err != nil {
+		return "", 0, errors.Wrapf(err, "wal-repair: failed to upload '%s'", repairedFileName)
+	}
+
+	return repairedFileName, written, nil
+}
+
+// AutoRepairWAL is the integration point wal-fetch's download-error path
+// should call when it hits a truncated WAL segment: if WALG_WAL_REPAIR is
+// enabled, it uploads a repaired ".repaired" copy of the segment (via
+// RepairWALObject) so the caller can retry against the repaired object and a
+// downstream replica can
+// proceed past a single corrupted tail record without manual intervention.
+// It's a no-op (false, nil) whenever WALG_WAL_REPAIR isn't set, or fetchErr
+// isn't the kind of truncated-record error Repair can fix.
+//
+// This snapshot doesn't contain a wal-fetch command to call it from, so for
+// now it has no callers; it exists so that command's download-error path has
+// a ready-made hook to call instead of reimplementing this wiring.
+func AutoRepairWAL(uploader *Uploader, walFileName string, fetchErr error) (repairedFileName string, repaired bool, err error) {
+	if !walrepair.IsTruncatedRecordError(fetchErr) {
+		return "", false, nil
+	}
+
+	enabled, err := configureWalRepair()
+	if err != nil {
+		return "", false, err
+	}
+	if !enabled {
+		return "", false, nil
+	}
+
+	repairedFileName, _, err = RepairWALObject(uploader.UploadingFolder, uploader.Compressor, ConfigureCrypter(), walFileName)
+	if err != nil {
+		return "", false, err
+	}
+	return repairedFileName, true, nil
+}
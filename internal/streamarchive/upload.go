@@ -0,0 +1,86 @@
+package streamarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/storages/storage"
+)
+
+// OffsetsFileSuffix names the sentinel-adjacent object that PackAndUpload
+// writes alongside the packed archive, recording where each file ended up so
+// a later partial restore can range-read just that file out of the archive
+// instead of downloading the whole object.
+const OffsetsFileSuffix = "_packed_offsets.json"
+
+// PackAndUpload packs files into a single tar-formatted object named
+// backupName in folder, then uploads a second small object recording the
+// FileOffset of each packed file.
+//
+// The archive itself is never fully materialized in memory: Pack's writer
+// goroutine feeds an io.Pipe that folder.PutObject reads from directly, so a
+// large base backup streams straight into storage instead of first being
+// buffered wholesale on the backup host.
+func (packer *Packer) PackAndUpload(folder storage.Folder, backupName string, files []string) ([]FileOffset, error) {
+	pipeReader, pipeWriter := io.Pipe()
+
+	var offsets []FileOffset
+	var packErr error
+	packDone := make(chan struct{})
+	go func() {
+		defer close(packDone)
+		var err error
+		offsets, err = packer.Pack(pipeWriter, files)
+		if err != nil {
+			packErr = err
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		pipeWriter.Close()
+	}()
+
+	if err := folder.PutObject(backupName, pipeReader); err != nil {
+		pipeReader.CloseWithError(err)
+		<-packDone
+		return nil, errors.Wrapf(err, "streamarchive: failed to upload packed archive '%s'", backupName)
+	}
+	<-packDone
+	if packErr != nil {
+		return nil, errors.Wrap(packErr, "streamarchive: failed to pack files")
+	}
+
+	offsetsBytes, err := json.Marshal(offsets)
+	if err != nil {
+		return nil, errors.Wrap(err, "streamarchive: failed to marshal file offsets")
+	}
+	offsetsName := backupName + OffsetsFileSuffix
+	if err := folder.PutObject(offsetsName, bytes.NewReader(offsetsBytes)); err != nil {
+		return nil, errors.Wrapf(err, "streamarchive: failed to upload file offsets '%s'", offsetsName)
+	}
+
+	return offsets, nil
+}
+
+// ReadOffsets downloads and decodes the FileOffset sentinel PackAndUpload
+// wrote for backupName, so a partial restore knows what byte range to
+// request for a given file.
+func ReadOffsets(folder storage.Folder, backupName string) ([]FileOffset, error) {
+	reader, err := folder.ReadObject(backupName + OffsetsFileSuffix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "streamarchive: failed to read file offsets for '%s'", backupName)
+	}
+	defer reader.Close()
+
+	offsetsBytes, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "streamarchive: failed to read file offsets")
+	}
+
+	var offsets []FileOffset
+	if err := json.Unmarshal(offsetsBytes, &offsets); err != nil {
+		return nil, errors.Wrap(err, "streamarchive: failed to decode file offsets")
+	}
+	return offsets, nil
+}
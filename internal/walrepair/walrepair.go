@@ -0,0 +1,102 @@
+// Package walrepair implements a repair mode analogous to etcd's
+// wal.Repair: when archived WAL replay hits a truncated final record, the
+// offending segment is truncated at the last valid record boundary and
+// re-uploaded under a ".repaired" suffix, leaving the original in place for
+// audit. This lets a downstream replica proceed past a single corrupted
+// tail record without manual intervention.
+//
+// Records are framed as a 4-byte big-endian length, the record bytes, then
+// a 4-byte big-endian CRC32 (IEEE) of those bytes.
+package walrepair
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxValidRecordSize bounds the record length ScanValidLength is willing to
+// believe before allocating a buffer for it. The length prefix is read
+// straight off a stream that, by definition, might be corrupt, so without a
+// cap a single bogus 4-byte prefix could claim up to 4 GiB and OOM the exact
+// tool whose job is to safely handle corrupted WAL. 16 MiB comfortably
+// covers any real WAL record (PostgreSQL itself caps these well under 1 GiB,
+// and in practice they're tiny).
+const maxValidRecordSize = 16 * 1024 * 1024
+
+// ErrAlreadyRepaired is returned by Repair when called a second time for the
+// same segment path within the same process run.
+var ErrAlreadyRepaired = errors.New("wal-repair: segment was already repaired once in this run")
+
+// attemptedSegments tracks segment paths Repair has already processed in
+// this run, so a caller retrying wal-fetch for the same segment doesn't
+// truncate it twice.
+var attemptedSegments sync.Map
+
+// IsTruncatedRecordError reports whether err is the kind of unexpectedly
+// ended WAL stream that Repair can fix.
+func IsTruncatedRecordError(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// ScanValidLength reads length-prefixed, CRC32-checked records from r and
+// returns how many bytes make up the longest valid prefix: every complete,
+// checksummed record up to (but not including) the first invalid or
+// truncated one. It never returns an error; a truncated or corrupt tail
+// simply stops the scan.
+func ScanValidLength(r io.Reader) int64 {
+	reader := bufio.NewReader(r)
+	var validBytes int64
+
+	for {
+		var lengthBuf [4]byte
+		if _, err := io.ReadFull(reader, lengthBuf[:]); err != nil {
+			return validBytes
+		}
+		recordLen := binary.BigEndian.Uint32(lengthBuf[:])
+		if recordLen > maxValidRecordSize {
+			return validBytes
+		}
+
+		record := make([]byte, recordLen)
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return validBytes
+		}
+
+		var crcBuf [4]byte
+		if _, err := io.ReadFull(reader, crcBuf[:]); err != nil {
+			return validBytes
+		}
+
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(crcBuf[:]) {
+			return validBytes
+		}
+
+		validBytes += int64(len(lengthBuf) + len(record) + len(crcBuf))
+	}
+}
+
+// Repair truncates the segment read from src at its last valid record
+// boundary, copying only the valid prefix to dst. segmentID identifies the
+// segment for the one-repair-per-run guard (typically its filename).
+func Repair(segmentID string, src io.ReadSeeker, dst io.Writer) (repairedBytes int64, err error) {
+	if _, alreadyAttempted := attemptedSegments.LoadOrStore(segmentID, struct{}{}); alreadyAttempted {
+		return 0, ErrAlreadyRepaired
+	}
+
+	validBytes := ScanValidLength(src)
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "wal-repair: failed to rewind segment")
+	}
+
+	written, err := io.CopyN(dst, src, validBytes)
+	if err != nil {
+		return written, errors.Wrap(err, "wal-repair: failed to write repaired copy")
+	}
+	return written, nil
+}
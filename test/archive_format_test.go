@@ -0,0 +1,64 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/xz"
+	"github.com/wal-g/wal-g/internal/compression/zstd"
+)
+
+func TestZstdCompressionCycle(t *testing.T) {
+	const plaintext = "hello from the zstd round trip test, repeated a bit to give it some body"
+
+	compressed := new(bytes.Buffer)
+	writer := zstd.Compressor{}.NewWriter(compressed)
+	_, err := writer.Write([]byte(plaintext))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	var decompressed bytes.Buffer
+	assert.NoError(t, zstd.Decompressor{}.Decompress(&decompressed, bytes.NewReader(compressed.Bytes())))
+	assert.Equal(t, plaintext, decompressed.String())
+}
+
+func TestXzCompressionCycle(t *testing.T) {
+	const plaintext = "hello from the xz round trip test, repeated a bit to give it some body"
+
+	compressed := new(bytes.Buffer)
+	writer := xz.Compressor{}.NewWriter(compressed)
+	_, err := writer.Write([]byte(plaintext))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	var decompressed bytes.Buffer
+	assert.NoError(t, xz.Decompressor{}.Decompress(&decompressed, bytes.NewReader(compressed.Bytes())))
+	assert.Equal(t, plaintext, decompressed.String())
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	zstdCompressed := new(bytes.Buffer)
+	zstdWriter := zstd.Compressor{}.NewWriter(zstdCompressed)
+	_, err := zstdWriter.Write([]byte("some data"))
+	assert.NoError(t, err)
+	assert.NoError(t, zstdWriter.Close())
+
+	format, ok := compression.DetectArchiveFormat(zstdCompressed.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, zstd.AlgorithmName, format.Name)
+
+	xzCompressed := new(bytes.Buffer)
+	xzWriter := xz.Compressor{}.NewWriter(xzCompressed)
+	_, err = xzWriter.Write([]byte("some data"))
+	assert.NoError(t, err)
+	assert.NoError(t, xzWriter.Close())
+
+	format, ok = compression.DetectArchiveFormat(xzCompressed.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, xz.AlgorithmName, format.Name)
+
+	_, ok = compression.DetectArchiveFormat([]byte("not a recognized archive header"))
+	assert.False(t, ok, "arbitrary bytes should not match any registered format")
+}
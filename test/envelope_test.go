@@ -0,0 +1,70 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+)
+
+const testEnvelopeKey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestEnvelopeEncryptionCycle(t *testing.T) {
+	crypter := envelope.CrypterFromKey(testEnvelopeKey)
+	const someSecret = "so very secret thingy"
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoErrorf(t, err, "Encryption error: %v", err)
+
+	_, err = encrypt.Write([]byte(someSecret))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	decrypt, err := crypter.Decrypt(buf)
+	assert.NoErrorf(t, err, "Decryption error: %v", err)
+
+	decryptedBytes, err := ioutil.ReadAll(decrypt)
+	assert.NoErrorf(t, err, "Decryption read error: %v", err)
+
+	assert.Equal(t, someSecret, string(decryptedBytes), "Decrypted text not equals open text")
+}
+
+func TestEnvelopeEncryptionMultipleFrames(t *testing.T) {
+	crypter := envelope.CrypterFromKey(testEnvelopeKey)
+	plaintext := bytes.Repeat([]byte("x"), envelope.FrameSize*2+123)
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write(plaintext)
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	decrypt, err := crypter.Decrypt(buf)
+	assert.NoError(t, err)
+
+	decryptedBytes, err := ioutil.ReadAll(decrypt)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, decryptedBytes)
+}
+
+func TestEnvelopeDecryptionDetectsTruncation(t *testing.T) {
+	crypter := envelope.CrypterFromKey(testEnvelopeKey)
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write([]byte("so very secret thingy"))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()-4])
+	decrypt, err := crypter.Decrypt(truncated)
+	assert.NoError(t, err)
+
+	_, err = ioutil.ReadAll(decrypt)
+	assert.Error(t, err, "truncated ciphertext should be rejected")
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto/envelope"
+	"github.com/wal-g/wal-g/internal/crypto/kms"
+)
+
+// mockKMSProvider stands in for a cloud KMS: it "wraps" a DEK by prefixing
+// it with its own name/key id instead of calling out to a real service, and
+// "unwraps" by checking that prefix, so tests can exercise KMSCrypter
+// without any cloud credentials.
+type mockKMSProvider struct {
+	name  string
+	keyID string
+}
+
+func (provider mockKMSProvider) Name() string  { return provider.name }
+func (provider mockKMSProvider) KeyID() string { return provider.keyID }
+
+func (provider mockKMSProvider) Encrypt(plaintextDEK []byte) ([]byte, error) {
+	wrapped := append([]byte(provider.name+"/"+provider.keyID+":"), plaintextDEK...)
+	return wrapped, nil
+}
+
+func (provider mockKMSProvider) Decrypt(wrappedDEK []byte) ([]byte, error) {
+	prefix := provider.name + "/" + provider.keyID + ":"
+	if !bytes.HasPrefix(wrappedDEK, []byte(prefix)) {
+		return nil, errors.New("mockKMSProvider: wrapped data key was not wrapped by this provider/key")
+	}
+	return wrappedDEK[len(prefix):], nil
+}
+
+func TestKMSCrypterEncryptionCycle(t *testing.T) {
+	crypter := envelope.NewKMSCrypter(mockKMSProvider{name: "mock", keyID: "key-1"})
+	const someSecret = "so very secret thingy, wrapped by a mock KMS this time"
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write([]byte(someSecret))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	decrypt, err := crypter.Decrypt(buf)
+	assert.NoError(t, err)
+
+	decryptedBytes, err := ioutil.ReadAll(decrypt)
+	assert.NoError(t, err)
+	assert.Equal(t, someSecret, string(decryptedBytes))
+}
+
+func TestKMSCrypterDecryptRejectsMismatchedProvider(t *testing.T) {
+	crypter := envelope.NewKMSCrypter(mockKMSProvider{name: "mock", keyID: "key-1"})
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write([]byte("some secret"))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	wrongKeyCrypter := envelope.NewKMSCrypter(mockKMSProvider{name: "mock", keyID: "key-2"})
+	_, err = wrongKeyCrypter.Decrypt(buf)
+	assert.Error(t, err, "unwrapping with the wrong key should fail, not silently succeed")
+}
+
+func TestKMSCrypterDecryptRejectsBadMagic(t *testing.T) {
+	crypter := envelope.NewKMSCrypter(mockKMSProvider{name: "mock", keyID: "key-1"})
+
+	_, err := crypter.Decrypt(bytes.NewReader([]byte("not a kms-wrapped stream at all")))
+	assert.Error(t, err)
+}
+
+func TestKMSCrypterDecryptRejectsTruncatedHeader(t *testing.T) {
+	crypter := envelope.NewKMSCrypter(mockKMSProvider{name: "mock", keyID: "key-1"})
+
+	buf := new(bytes.Buffer)
+	encrypt, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write([]byte("some secret"))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	truncated := bytes.NewReader(buf.Bytes()[:5])
+	_, err = crypter.Decrypt(truncated)
+	assert.Error(t, err, "a header cut off mid-way through should fail to parse, not panic or return garbage")
+}
+
+var _ kms.Provider = mockKMSProvider{}
@@ -0,0 +1,40 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/pgzip"
+)
+
+func TestPgzipCompressionCycle(t *testing.T) {
+	const plaintext = "hello from the pgzip round trip test, repeated a bit to give it some body"
+
+	compressed := new(bytes.Buffer)
+	writer := pgzip.Compressor{}.NewWriter(compressed)
+	_, err := writer.Write([]byte(plaintext))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	var decompressed bytes.Buffer
+	assert.NoError(t, pgzip.Decompressor{}.Decompress(&decompressed, bytes.NewReader(compressed.Bytes())))
+	assert.Equal(t, plaintext, decompressed.String())
+}
+
+func TestPgzipRegistersArchiveFormat(t *testing.T) {
+	compressed := new(bytes.Buffer)
+	writer := pgzip.Compressor{}.NewWriter(compressed)
+	_, err := writer.Write([]byte("some data"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	header, err := ioutil.ReadAll(bytes.NewReader(compressed.Bytes()))
+	assert.NoError(t, err)
+
+	format, ok := compression.DetectArchiveFormat(header)
+	assert.True(t, ok, "pgzip output should be detected by its registered magic bytes")
+	assert.Equal(t, pgzip.AlgorithmName, format.Name)
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/streamarchive"
+)
+
+// identityCompressor passes bytes through unchanged, so the test can assert
+// on file contents directly without depending on a real compression format.
+type identityCompressor struct{}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (identityCompressor) NewWriter(writer io.Writer) io.WriteCloser {
+	return nopWriteCloser{writer}
+}
+
+func (identityCompressor) FileExtension() string {
+	return "raw"
+}
+
+func writeTempFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestPacker_Pack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "streamarchive-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	contents := map[string]string{
+		"a.txt": "hello from a",
+		"b.txt": "hello from b, a bit longer",
+	}
+	var files []string
+	for name, content := range contents {
+		files = append(files, writeTempFile(t, dir, name, content))
+	}
+
+	packer := streamarchive.NewPacker(identityCompressor{}, 2)
+
+	archive := new(bytes.Buffer)
+	offsets, err := packer.Pack(archive, files)
+	assert.NoError(t, err)
+	assert.Len(t, offsets, len(files))
+
+	archiveBytes := archive.Bytes()
+	for _, offset := range offsets {
+		content := contents[filepath.Base(offset.Path)]
+		body := archiveBytes[offset.Offset : offset.Offset+offset.Size]
+		assert.Equal(t, content, string(body))
+		assert.Equal(t, crc32.ChecksumIEEE(body), offset.CRC32)
+	}
+
+	tarReader := tar.NewReader(bytes.NewReader(archiveBytes))
+	seen := 0
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+		body, err := ioutil.ReadAll(tarReader)
+		assert.NoError(t, err)
+		assert.Equal(t, contents[filepath.Base(header.Name)], string(body))
+		seen++
+	}
+	assert.Equal(t, len(files), seen)
+}
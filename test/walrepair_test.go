@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/walrepair"
+)
+
+func appendRecord(buf *bytes.Buffer, record []byte) {
+	var lengthBuf [4]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], uint32(len(record)))
+	buf.Write(lengthBuf[:])
+	buf.Write(record)
+	var crcBuf [4]byte
+	binary.BigEndian.PutUint32(crcBuf[:], crc32.ChecksumIEEE(record))
+	buf.Write(crcBuf[:])
+}
+
+func TestScanValidLength_AllValid(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+	appendRecord(buf, []byte("second record"))
+
+	assert.EqualValues(t, buf.Len(), walrepair.ScanValidLength(bytes.NewReader(buf.Bytes())))
+}
+
+func TestScanValidLength_StopsAtTruncatedTail(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+	validLength := buf.Len()
+	buf.Write([]byte{0x00, 0x00, 0x00, 0x10, 0x01, 0x02}) // partial next record
+
+	assert.EqualValues(t, validLength, walrepair.ScanValidLength(bytes.NewReader(buf.Bytes())))
+}
+
+func TestScanValidLength_StopsAtBadChecksum(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+	validLength := buf.Len()
+	appendRecord(buf, []byte("second record"))
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xff // flip a bit in the second record's CRC
+
+	assert.EqualValues(t, validLength, walrepair.ScanValidLength(bytes.NewReader(corrupted)))
+}
+
+func TestScanValidLength_StopsAtImplausibleRecordLength(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+	validLength := buf.Len()
+	// A corrupt length prefix claiming a multi-gigabyte record must not be
+	// trusted enough to allocate; it should just end the valid prefix here.
+	var lengthBuf [4]byte
+	binary.BigEndian.PutUint32(lengthBuf[:], 0xffffffff)
+	buf.Write(lengthBuf[:])
+
+	assert.EqualValues(t, validLength, walrepair.ScanValidLength(bytes.NewReader(buf.Bytes())))
+}
+
+func TestRepair_TruncatesAtLastValidRecord(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+	validLength := buf.Len()
+	buf.Write([]byte{0x00, 0x00, 0x00, 0x10, 0x01, 0x02})
+
+	var repaired bytes.Buffer
+	written, err := walrepair.Repair("000000010000000000000001", bytes.NewReader(buf.Bytes()), &repaired)
+	assert.NoError(t, err)
+	assert.EqualValues(t, validLength, written)
+	assert.EqualValues(t, validLength, repaired.Len())
+}
+
+func TestRepair_RefusesSecondAttempt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	appendRecord(buf, []byte("first record"))
+
+	var repaired bytes.Buffer
+	_, err := walrepair.Repair("000000010000000000000002", bytes.NewReader(buf.Bytes()), &repaired)
+	assert.NoError(t, err)
+
+	_, err = walrepair.Repair("000000010000000000000002", bytes.NewReader(buf.Bytes()), &repaired)
+	assert.ErrorIs(t, err, walrepair.ErrAlreadyRepaired)
+}